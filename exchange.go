@@ -0,0 +1,572 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExchangeAdapter abstracts everything venue-specific about L3
+// reconstruction (snapshot/stream URLs, message shapes, and sequence
+// continuity rules) so the reconstruction engine, connectAndSync, and
+// PrecisionManager stay exchange-agnostic, similar to the multi-exchange
+// abstraction in goex/bbgo.
+type ExchangeAdapter interface {
+	// Name identifies the adapter for logging, e.g. "binance-futures".
+	Name() string
+
+	// SnapshotURL returns the REST endpoint for a full L2 snapshot of
+	// symbol. connectAndSync always fetches it over REST when it does not
+	// resume from persisted state; there is no path for a snapshot sent
+	// over WS.
+	SnapshotURL(symbol string) string
+
+	// StreamURL returns the WS endpoint to dial for symbol's depth diffs.
+	StreamURL(symbol string) string
+
+	// SubscribeMessage returns a frame to send right after dialing
+	// StreamURL, or nil if the venue embeds the symbol in the URL and
+	// needs no subscribe handshake.
+	SubscribeMessage(symbol string) []byte
+
+	// ExchangeInfoURL returns the REST endpoint used to fetch tick/step
+	// size precision for symbols.
+	ExchangeInfoURL() string
+
+	// ParseSnapshot decodes a REST snapshot response into venue-agnostic form.
+	ParseSnapshot(body []byte) (*DepthSnapshot, error)
+
+	// ParseDelta decodes one WS message into a venue-agnostic depth delta.
+	// A nil delta with a nil error means the message carried no depth data
+	// (e.g. a subscribe ack) and should be skipped.
+	ParseDelta(msg []byte) (*DepthDelta, error)
+
+	// ParsePrecision decodes an exchange-info response into precision data
+	// for symbol.
+	ParsePrecision(body []byte, symbol string) (*PrecisionInfo, error)
+
+	// ValidateSequence checks whether delta continues the tracked sequence
+	// rooted at lastApplied/synced. It returns the updated lastApplied and
+	// synced state, and a non-nil error on a detected gap.
+	ValidateSequence(lastApplied int64, synced bool, delta *DepthDelta) (newLastApplied int64, stillSynced bool, gap error)
+}
+
+// DepthSnapshot is the venue-agnostic form of a REST L2 snapshot.
+type DepthSnapshot struct {
+	LastUpdateID int64
+	Bids         [][2]string // price, qty
+	Asks         [][2]string
+}
+
+// DepthDelta is the venue-agnostic form of one WS depth-diff event.
+type DepthDelta struct {
+	FirstUpdateID     int64 // 0 if the venue doesn't distinguish first/final
+	FinalUpdateID     int64
+	PrevFinalUpdateID int64 // 0 if the venue doesn't provide one
+	Bids              [][2]string
+	Asks              [][2]string
+}
+
+// newAdapterFromEnv picks an ExchangeAdapter the same way persistence is
+// chosen: an environment variable with a sane default, no config file.
+func newAdapterFromEnv() ExchangeAdapter {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("EXCHANGE"))) {
+	case "binance-spot":
+		return &BinanceSpotAdapter{}
+	case "bybit", "bybit-linear":
+		return &BybitLinearAdapter{}
+	case "okx":
+		return &OKXAdapter{}
+	default:
+		return &BinanceFuturesAdapter{}
+	}
+}
+
+// --- Binance USD-M Futures -------------------------------------------------
+
+// combinedStreamURL builds a Binance combined-stream URL so a sync goroutine
+// can dial the same multi-stream endpoint used for multi-symbol
+// subscriptions, even when it only asks for one stream.
+func combinedStreamURL(host string, streams ...string) string {
+	return fmt.Sprintf("wss://%s/stream?streams=%s", host, strings.Join(streams, "/"))
+}
+
+// binanceCombinedEnvelope wraps every payload on the combined-stream
+// endpoint as {"stream": "<name>", "data": <payload>}.
+type binanceCombinedEnvelope struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// unwrapCombinedMessage extracts the inner payload from a combined-stream
+// message.
+func unwrapCombinedMessage(raw []byte) (json.RawMessage, error) {
+	var envelope binanceCombinedEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, err
+	}
+	return envelope.Data, nil
+}
+
+type binanceWSUpdate struct {
+	FirstUpdateID     int64      `json:"U"`
+	FinalUpdateID     int64      `json:"u"`
+	PrevFinalUpdateID int64      `json:"pu"`
+	B                 [][]string `json:"b"`
+	A                 [][]string `json:"a"`
+}
+
+type binanceRESTResp struct {
+	LastUpdateID int64      `json:"lastUpdateId"`
+	Bids         [][]string `json:"bids"`
+	Asks         [][]string `json:"asks"`
+}
+
+type binanceExchangeInfo struct {
+	Symbols []binanceSymbolInfo `json:"symbols"`
+}
+
+type binanceSymbolInfo struct {
+	Symbol  string         `json:"symbol"`
+	Filters []binanceFilter `json:"filters"`
+}
+
+type binanceFilter struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize,omitempty"`
+	StepSize   string `json:"stepSize,omitempty"`
+}
+
+func parseBinanceExchangeInfo(body []byte, symbol string) (*PrecisionInfo, error) {
+	var info binanceExchangeInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("decode exchange info: %w", err)
+	}
+
+	upperSymbol := strings.ToUpper(symbol)
+	for _, s := range info.Symbols {
+		if s.Symbol != upperSymbol {
+			continue
+		}
+
+		precisionInfo := &PrecisionInfo{
+			Symbol:         symbol,
+			PricePrecision: 2,
+			QtyPrecision:   2,
+			TickSize:       "0.01",
+			StepSize:       "0.01",
+		}
+		for _, filter := range s.Filters {
+			switch filter.FilterType {
+			case "PRICE_FILTER":
+				if filter.TickSize != "" {
+					precisionInfo.TickSize = filter.TickSize
+					precisionInfo.PricePrecision = calculatePrecision(filter.TickSize)
+				}
+			case "LOT_SIZE":
+				if filter.StepSize != "" {
+					precisionInfo.StepSize = filter.StepSize
+					precisionInfo.QtyPrecision = calculatePrecision(filter.StepSize)
+				}
+			}
+		}
+		return precisionInfo, nil
+	}
+
+	return nil, fmt.Errorf("symbol %s not found in exchange info", upperSymbol)
+}
+
+// BinanceFuturesAdapter targets Binance's USD-M futures depth stream, the
+// original (and still default) venue this tool reconstructs.
+type BinanceFuturesAdapter struct{}
+
+func (a *BinanceFuturesAdapter) Name() string { return "binance-futures" }
+
+func (a *BinanceFuturesAdapter) SnapshotURL(symbol string) string {
+	return fmt.Sprintf("https://fapi.binance.com/fapi/v1/depth?symbol=%s&limit=1000", strings.ToUpper(symbol))
+}
+
+func (a *BinanceFuturesAdapter) StreamURL(symbol string) string {
+	return combinedStreamURL("fstream.binance.com", fmt.Sprintf("%s@depth@100ms", symbol))
+}
+
+func (a *BinanceFuturesAdapter) SubscribeMessage(symbol string) []byte { return nil }
+
+func (a *BinanceFuturesAdapter) ExchangeInfoURL() string {
+	return "https://fapi.binance.com/fapi/v1/exchangeInfo"
+}
+
+func (a *BinanceFuturesAdapter) ParseSnapshot(body []byte) (*DepthSnapshot, error) {
+	var resp binanceRESTResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.LastUpdateID == 0 {
+		return nil, fmt.Errorf("snapshot missing lastUpdateId")
+	}
+	return &DepthSnapshot{LastUpdateID: resp.LastUpdateID, Bids: pairs(resp.Bids), Asks: pairs(resp.Asks)}, nil
+}
+
+func (a *BinanceFuturesAdapter) ParseDelta(msg []byte) (*DepthDelta, error) {
+	data, err := unwrapCombinedMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	var update binanceWSUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return nil, err
+	}
+	return &DepthDelta{
+		FirstUpdateID:     update.FirstUpdateID,
+		FinalUpdateID:     update.FinalUpdateID,
+		PrevFinalUpdateID: update.PrevFinalUpdateID,
+		Bids:              pairs(update.B),
+		Asks:              pairs(update.A),
+	}, nil
+}
+
+func (a *BinanceFuturesAdapter) ParsePrecision(body []byte, symbol string) (*PrecisionInfo, error) {
+	return parseBinanceExchangeInfo(body, symbol)
+}
+
+// ValidateSequence implements Binance futures' managed-book procedure: the
+// first applied event must straddle the snapshot, and every event after
+// that must chain via pu == previous u.
+func (a *BinanceFuturesAdapter) ValidateSequence(lastApplied int64, synced bool, delta *DepthDelta) (int64, bool, error) {
+	if delta.FinalUpdateID < lastApplied {
+		return lastApplied, synced, nil
+	}
+	if !synced {
+		if delta.FirstUpdateID > lastApplied+1 {
+			return lastApplied, synced, fmt.Errorf("no event straddles snapshot: U=%d lastUpdateId=%d", delta.FirstUpdateID, lastApplied)
+		}
+		return delta.FinalUpdateID, true, nil
+	}
+	if delta.PrevFinalUpdateID != lastApplied {
+		return lastApplied, synced, fmt.Errorf("sequence gap: pu=%d expected=%d", delta.PrevFinalUpdateID, lastApplied)
+	}
+	return delta.FinalUpdateID, true, nil
+}
+
+// --- Binance Spot ------------------------------------------------------------
+
+// BinanceSpotAdapter targets Binance's spot depth stream. Spot diffs don't
+// carry a pu field, so continuity is validated by requiring each event's U
+// to equal the previous event's u + 1.
+type BinanceSpotAdapter struct{}
+
+func (a *BinanceSpotAdapter) Name() string { return "binance-spot" }
+
+func (a *BinanceSpotAdapter) SnapshotURL(symbol string) string {
+	return fmt.Sprintf("https://api.binance.com/api/v3/depth?symbol=%s&limit=1000", strings.ToUpper(symbol))
+}
+
+func (a *BinanceSpotAdapter) StreamURL(symbol string) string {
+	return combinedStreamURL("stream.binance.com:9443", fmt.Sprintf("%s@depth@100ms", symbol))
+}
+
+func (a *BinanceSpotAdapter) SubscribeMessage(symbol string) []byte { return nil }
+
+func (a *BinanceSpotAdapter) ExchangeInfoURL() string {
+	return "https://api.binance.com/api/v3/exchangeInfo"
+}
+
+func (a *BinanceSpotAdapter) ParseSnapshot(body []byte) (*DepthSnapshot, error) {
+	var resp binanceRESTResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.LastUpdateID == 0 {
+		return nil, fmt.Errorf("snapshot missing lastUpdateId")
+	}
+	return &DepthSnapshot{LastUpdateID: resp.LastUpdateID, Bids: pairs(resp.Bids), Asks: pairs(resp.Asks)}, nil
+}
+
+func (a *BinanceSpotAdapter) ParseDelta(msg []byte) (*DepthDelta, error) {
+	data, err := unwrapCombinedMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	var update binanceWSUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		return nil, err
+	}
+	return &DepthDelta{
+		FirstUpdateID: update.FirstUpdateID,
+		FinalUpdateID: update.FinalUpdateID,
+		Bids:          pairs(update.B),
+		Asks:          pairs(update.A),
+	}, nil
+}
+
+func (a *BinanceSpotAdapter) ParsePrecision(body []byte, symbol string) (*PrecisionInfo, error) {
+	return parseBinanceExchangeInfo(body, symbol)
+}
+
+func (a *BinanceSpotAdapter) ValidateSequence(lastApplied int64, synced bool, delta *DepthDelta) (int64, bool, error) {
+	if delta.FinalUpdateID < lastApplied {
+		return lastApplied, synced, nil
+	}
+	if !synced {
+		if delta.FirstUpdateID > lastApplied+1 {
+			return lastApplied, synced, fmt.Errorf("no event straddles snapshot: U=%d lastUpdateId=%d", delta.FirstUpdateID, lastApplied)
+		}
+		return delta.FinalUpdateID, true, nil
+	}
+	if delta.FirstUpdateID != lastApplied+1 {
+		return lastApplied, synced, fmt.Errorf("sequence gap: U=%d expected=%d", delta.FirstUpdateID, lastApplied+1)
+	}
+	return delta.FinalUpdateID, true, nil
+}
+
+// --- Bybit linear perpetuals -------------------------------------------------
+
+type bybitOrderbookMessage struct {
+	Topic string `json:"topic"`
+	Type  string `json:"type"` // "snapshot" or "delta"
+	Data  struct {
+		Seq int64      `json:"seq"`
+		U   int64      `json:"u"`
+		B   [][]string `json:"b"`
+		A   [][]string `json:"a"`
+	} `json:"data"`
+}
+
+type bybitRESTOrderbook struct {
+	RetCode int `json:"retCode"`
+	Result  struct {
+		Bids []([]string) `json:"b"`
+		Asks []([]string) `json:"a"`
+		U    int64        `json:"u"`
+	} `json:"result"`
+}
+
+type bybitInstrumentsInfo struct {
+	Result struct {
+		List []struct {
+			Symbol     string `json:"symbol"`
+			PriceScale string `json:"priceScale"`
+			LotSizeFilter struct {
+				QtyStep string `json:"qtyStep"`
+			} `json:"lotSizeFilter"`
+			PriceFilter struct {
+				TickSize string `json:"tickSize"`
+			} `json:"priceFilter"`
+		} `json:"list"`
+	} `json:"result"`
+}
+
+// BybitLinearAdapter targets Bybit's v5 linear-perpetual orderbook topic.
+type BybitLinearAdapter struct{}
+
+func (a *BybitLinearAdapter) Name() string { return "bybit-linear" }
+
+func (a *BybitLinearAdapter) SnapshotURL(symbol string) string {
+	return fmt.Sprintf("https://api.bybit.com/v5/market/orderbook?category=linear&symbol=%s&limit=200", strings.ToUpper(symbol))
+}
+
+func (a *BybitLinearAdapter) StreamURL(symbol string) string {
+	return "wss://stream.bybit.com/v5/public/linear"
+}
+
+func (a *BybitLinearAdapter) SubscribeMessage(symbol string) []byte {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"op":   "subscribe",
+		"args": []string{fmt.Sprintf("orderbook.200.%s", strings.ToUpper(symbol))},
+	})
+	return msg
+}
+
+func (a *BybitLinearAdapter) ExchangeInfoURL() string {
+	return "https://api.bybit.com/v5/market/instruments-info?category=linear"
+}
+
+func (a *BybitLinearAdapter) ParseSnapshot(body []byte) (*DepthSnapshot, error) {
+	var resp bybitRESTOrderbook
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.RetCode != 0 {
+		return nil, fmt.Errorf("bybit orderbook request failed: retCode=%d", resp.RetCode)
+	}
+	return &DepthSnapshot{LastUpdateID: resp.Result.U, Bids: pairs(resp.Result.Bids), Asks: pairs(resp.Result.Asks)}, nil
+}
+
+func (a *BybitLinearAdapter) ParseDelta(msg []byte) (*DepthDelta, error) {
+	var ob bybitOrderbookMessage
+	if err := json.Unmarshal(msg, &ob); err != nil {
+		return nil, err
+	}
+	if ob.Type == "" {
+		// Not an orderbook message (e.g. a subscribe ack); nothing to apply.
+		return nil, nil
+	}
+	return &DepthDelta{FinalUpdateID: ob.Data.U, Bids: pairs(ob.Data.B), Asks: pairs(ob.Data.A)}, nil
+}
+
+func (a *BybitLinearAdapter) ParsePrecision(body []byte, symbol string) (*PrecisionInfo, error) {
+	var info bybitInstrumentsInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("decode instruments info: %w", err)
+	}
+
+	upperSymbol := strings.ToUpper(symbol)
+	for _, s := range info.Result.List {
+		if s.Symbol != upperSymbol {
+			continue
+		}
+		precisionInfo := &PrecisionInfo{
+			Symbol:         symbol,
+			TickSize:       s.PriceFilter.TickSize,
+			StepSize:       s.LotSizeFilter.QtyStep,
+			PricePrecision: calculatePrecision(s.PriceFilter.TickSize),
+			QtyPrecision:   calculatePrecision(s.LotSizeFilter.QtyStep),
+		}
+		return precisionInfo, nil
+	}
+	return nil, fmt.Errorf("symbol %s not found in instruments info", upperSymbol)
+}
+
+// ValidateSequence treats Bybit's per-level "u" as a monotonically
+// increasing update id; anything not strictly greater than lastApplied is
+// stale and anything else continues the sequence (Bybit itself guarantees
+// delivery order over one websocket, unlike Binance's pu-chained diffs).
+func (a *BybitLinearAdapter) ValidateSequence(lastApplied int64, synced bool, delta *DepthDelta) (int64, bool, error) {
+	if delta.FinalUpdateID <= lastApplied {
+		return lastApplied, synced, nil
+	}
+	return delta.FinalUpdateID, true, nil
+}
+
+// --- OKX ----------------------------------------------------------------
+
+type okxBooksMessage struct {
+	Arg struct {
+		Channel string `json:"channel"`
+	} `json:"arg"`
+	Action string `json:"action"` // "snapshot" or "update"
+	Data   []struct {
+		Bids     [][]string `json:"bids"`
+		Asks     [][]string `json:"asks"`
+		SeqID    int64      `json:"seqId"`
+		PrevSeqID int64     `json:"prevSeqId"`
+	} `json:"data"`
+}
+
+type okxRESTBooks struct {
+	Data []struct {
+		Bids  [][]string `json:"bids"`
+		Asks  [][]string `json:"asks"`
+		SeqID int64      `json:"seqId"`
+	} `json:"data"`
+}
+
+type okxInstruments struct {
+	Data []struct {
+		InstID  string `json:"instId"`
+		TickSz  string `json:"tickSz"`
+		LotSz   string `json:"lotSz"`
+	} `json:"data"`
+}
+
+// OKXAdapter targets OKX's v5 public order book channel.
+type OKXAdapter struct{}
+
+func (a *OKXAdapter) Name() string { return "okx" }
+
+func (a *OKXAdapter) SnapshotURL(symbol string) string {
+	return fmt.Sprintf("https://www.okx.com/api/v5/market/books?instId=%s&sz=400", strings.ToUpper(symbol))
+}
+
+func (a *OKXAdapter) StreamURL(symbol string) string {
+	return "wss://ws.okx.com:8443/ws/v5/public"
+}
+
+func (a *OKXAdapter) SubscribeMessage(symbol string) []byte {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"op": "subscribe",
+		"args": []map[string]string{
+			{"channel": "books", "instId": strings.ToUpper(symbol)},
+		},
+	})
+	return msg
+}
+
+func (a *OKXAdapter) ExchangeInfoURL() string {
+	return "https://www.okx.com/api/v5/public/instruments?instType=SPOT"
+}
+
+func (a *OKXAdapter) ParseSnapshot(body []byte) (*DepthSnapshot, error) {
+	var resp okxRESTBooks
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("empty OKX order book response")
+	}
+	d := resp.Data[0]
+	return &DepthSnapshot{LastUpdateID: d.SeqID, Bids: pairs(d.Bids), Asks: pairs(d.Asks)}, nil
+}
+
+func (a *OKXAdapter) ParseDelta(msg []byte) (*DepthDelta, error) {
+	var ob okxBooksMessage
+	if err := json.Unmarshal(msg, &ob); err != nil {
+		return nil, err
+	}
+	if len(ob.Data) == 0 {
+		return nil, nil
+	}
+	d := ob.Data[0]
+	return &DepthDelta{FinalUpdateID: d.SeqID, PrevFinalUpdateID: d.PrevSeqID, Bids: pairs(d.Bids), Asks: pairs(d.Asks)}, nil
+}
+
+func (a *OKXAdapter) ParsePrecision(body []byte, symbol string) (*PrecisionInfo, error) {
+	var info okxInstruments
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("decode instruments: %w", err)
+	}
+
+	upperSymbol := strings.ToUpper(symbol)
+	for _, d := range info.Data {
+		if d.InstID != upperSymbol {
+			continue
+		}
+		return &PrecisionInfo{
+			Symbol:         symbol,
+			TickSize:       d.TickSz,
+			StepSize:       d.LotSz,
+			PricePrecision: calculatePrecision(d.TickSz),
+			QtyPrecision:   calculatePrecision(d.LotSz),
+		}, nil
+	}
+	return nil, fmt.Errorf("symbol %s not found in instruments", upperSymbol)
+}
+
+// ValidateSequence chains OKX's seqId/prevSeqId the same way Binance
+// futures chains u/pu.
+func (a *OKXAdapter) ValidateSequence(lastApplied int64, synced bool, delta *DepthDelta) (int64, bool, error) {
+	if delta.FinalUpdateID < lastApplied {
+		return lastApplied, synced, nil
+	}
+	if !synced {
+		return delta.FinalUpdateID, true, nil
+	}
+	if delta.PrevFinalUpdateID != lastApplied {
+		return lastApplied, synced, fmt.Errorf("sequence gap: prevSeqId=%d expected=%d", delta.PrevFinalUpdateID, lastApplied)
+	}
+	return delta.FinalUpdateID, true, nil
+}
+
+// pairs converts [][]string price/qty rows into fixed [2]string pairs,
+// dropping any malformed rows.
+func pairs(rows [][]string) [][2]string {
+	out := make([][2]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		out = append(out, [2]string{row[0], row[1]})
+	}
+	return out
+}
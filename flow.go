@@ -0,0 +1,258 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// flowInterval is how often OrderFlowAnalyzer rolls up observed queue
+// mutations into a published FlowMetrics snapshot.
+const flowInterval = 1 * time.Second
+
+// flowRingSize bounds how many past snapshots are kept so the frontend can
+// plot cancel/add pressure over time.
+const flowRingSize = 300
+
+// flowLargeOrderMultiple flags a newly added order as a "large order
+// arrival" when it exceeds this multiple of its level's prior average
+// order size.
+const flowLargeOrderMultiple = 3
+
+// flowImbalanceDepth is how many top price levels feed the queue-imbalance
+// metric.
+const flowImbalanceDepth = 10
+
+// LargeOrderEvent records one order addition that stood out against its
+// level's prior average size.
+type LargeOrderEvent struct {
+	Side      string          `json:"side"`
+	Price     string          `json:"price"`
+	Size      decimal.Decimal `json:"size"`
+	PriorAvg  decimal.Decimal `json:"prior_avg"`
+	Timestamp int64           `json:"timestamp"`
+}
+
+// FlowMetrics is one interval's worth of order-flow analytics, combining
+// mutation counters accumulated since the previous snapshot with book-wide
+// stats read at snapshot time.
+type FlowMetrics struct {
+	Symbol                 string            `json:"symbol"`
+	Timestamp              int64             `json:"timestamp"`
+	AddedCount             int               `json:"added_count"`
+	AddedVolume            decimal.Decimal   `json:"added_volume"`
+	CancelledCount         int               `json:"cancelled_count"`
+	CancelledVolume        decimal.Decimal   `json:"cancelled_volume"`
+	MarketBuyVolume        decimal.Decimal   `json:"market_buy_volume"`
+	MarketSellVolume       decimal.Decimal   `json:"market_sell_volume"`
+	QueueImbalance         float64           `json:"queue_imbalance"` // top-N bid orders vs ask orders, [-1, 1]
+	AvgRestingOrderSize    decimal.Decimal   `json:"avg_resting_order_size"`
+	MedianRestingOrderSize decimal.Decimal   `json:"median_resting_order_size"`
+	LargeOrders            []LargeOrderEvent `json:"large_orders,omitempty"`
+}
+
+// OrderFlowAnalyzer derives per-interval add/cancel/market-order metrics
+// from an L3OrderBook's queue mutations, turning the reconstructed queues
+// into an analytics stream on top of the plain viewer.
+type OrderFlowAnalyzer struct {
+	symbol string
+
+	mu               sync.Mutex
+	addedCount       int
+	addedVolume      decimal.Decimal
+	cancelledCount   int
+	cancelledVolume  decimal.Decimal
+	marketBuyVolume  decimal.Decimal
+	marketSellVolume decimal.Decimal
+	largeOrders      []LargeOrderEvent
+
+	ringMu sync.RWMutex
+	ring   []FlowMetrics
+}
+
+func NewOrderFlowAnalyzer(symbol string) *OrderFlowAnalyzer {
+	return &OrderFlowAnalyzer{
+		symbol:           symbol,
+		addedVolume:      decimal.Zero,
+		cancelledVolume:  decimal.Zero,
+		marketBuyVolume:  decimal.Zero,
+		marketSellVolume: decimal.Zero,
+	}
+}
+
+// recordAdd notes a new order placed at the back of a queue, flagging it as
+// a large-order arrival when it dwarfs the level's prior average order
+// size.
+func (fa *OrderFlowAnalyzer) recordAdd(side, price string, size, priorAvg decimal.Decimal) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+
+	fa.addedCount++
+	fa.addedVolume = fa.addedVolume.Add(size)
+
+	if priorAvg.IsPositive() && size.GreaterThan(priorAvg.Mul(decimal.NewFromInt(flowLargeOrderMultiple))) {
+		fa.largeOrders = append(fa.largeOrders, LargeOrderEvent{
+			Side:      side,
+			Price:     price,
+			Size:      size,
+			PriorAvg:  priorAvg,
+			Timestamp: time.Now().UnixMilli(),
+		})
+	}
+}
+
+// recordCancel notes volume removed or reduced by the largest-order-first
+// cancellation heuristic, as opposed to volume explained by a real trade.
+func (fa *OrderFlowAnalyzer) recordCancel(size decimal.Decimal) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	fa.cancelledCount++
+	fa.cancelledVolume = fa.cancelledVolume.Add(size)
+}
+
+// recordMarketVolume notes volume explained by the trade-integration path
+// (applyTrade), attributed to the side that initiated the fill: a
+// buyer-maker trade means a resting bid got hit by a market sell, and vice
+// versa.
+func (fa *OrderFlowAnalyzer) recordMarketVolume(isBuyerMaker bool, qty decimal.Decimal) {
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	if isBuyerMaker {
+		fa.marketSellVolume = fa.marketSellVolume.Add(qty)
+	} else {
+		fa.marketBuyVolume = fa.marketBuyVolume.Add(qty)
+	}
+}
+
+// snapshot rolls up everything recorded since the last call into a
+// FlowMetrics, folds in book-wide imbalance/resting-size stats computed
+// from the current queues, appends it to the ring buffer, and resets the
+// interval counters.
+func (fa *OrderFlowAnalyzer) snapshot(bids, asks map[string]*OrderQueue) FlowMetrics {
+	fa.mu.Lock()
+	metrics := FlowMetrics{
+		Symbol:           fa.symbol,
+		Timestamp:        time.Now().UnixMilli(),
+		AddedCount:       fa.addedCount,
+		AddedVolume:      fa.addedVolume,
+		CancelledCount:   fa.cancelledCount,
+		CancelledVolume:  fa.cancelledVolume,
+		MarketBuyVolume:  fa.marketBuyVolume,
+		MarketSellVolume: fa.marketSellVolume,
+		LargeOrders:      fa.largeOrders,
+	}
+	fa.addedCount, fa.addedVolume = 0, decimal.Zero
+	fa.cancelledCount, fa.cancelledVolume = 0, decimal.Zero
+	fa.marketBuyVolume, fa.marketSellVolume = decimal.Zero, decimal.Zero
+	fa.largeOrders = nil
+	fa.mu.Unlock()
+
+	metrics.QueueImbalance = queueImbalance(bids, asks)
+	metrics.AvgRestingOrderSize, metrics.MedianRestingOrderSize = restingOrderStats(bids, asks)
+
+	fa.ringMu.Lock()
+	fa.ring = append(fa.ring, metrics)
+	if len(fa.ring) > flowRingSize {
+		fa.ring = fa.ring[len(fa.ring)-flowRingSize:]
+	}
+	fa.ringMu.Unlock()
+
+	return metrics
+}
+
+// History returns every FlowMetrics currently held in the ring buffer,
+// oldest first.
+func (fa *OrderFlowAnalyzer) History() []FlowMetrics {
+	fa.ringMu.RLock()
+	defer fa.ringMu.RUnlock()
+	out := make([]FlowMetrics, len(fa.ring))
+	copy(out, fa.ring)
+	return out
+}
+
+// Latest returns the most recent FlowMetrics, if any have been published
+// yet.
+func (fa *OrderFlowAnalyzer) Latest() (FlowMetrics, bool) {
+	fa.ringMu.RLock()
+	defer fa.ringMu.RUnlock()
+	if len(fa.ring) == 0 {
+		return FlowMetrics{}, false
+	}
+	return fa.ring[len(fa.ring)-1], true
+}
+
+// queueImbalance compares resting order counts across the top
+// flowImbalanceDepth price levels on each side: +1 means entirely bid-side
+// orders, -1 entirely ask-side, 0 balanced.
+func queueImbalance(bids, asks map[string]*OrderQueue) float64 {
+	bidOrders := topOrderCount(bids, true)
+	askOrders := topOrderCount(asks, false)
+	total := bidOrders + askOrders
+	if total == 0 {
+		return 0
+	}
+	return float64(bidOrders-askOrders) / float64(total)
+}
+
+// topOrderCount sums resting order counts over the top flowImbalanceDepth
+// price levels of side, sorted descending for bids / ascending for asks.
+func topOrderCount(side map[string]*OrderQueue, descending bool) int {
+	prices := make([]string, 0, len(side))
+	for price := range side {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		pi, _ := decimal.NewFromString(prices[i])
+		pj, _ := decimal.NewFromString(prices[j])
+		if descending {
+			return pi.GreaterThan(pj)
+		}
+		return pi.LessThan(pj)
+	})
+
+	count := 0
+	for i := 0; i < len(prices) && i < flowImbalanceDepth; i++ {
+		queue := side[prices[i]]
+		queue.mu.RLock()
+		count += len(queue.orders)
+		queue.mu.RUnlock()
+	}
+	return count
+}
+
+// restingOrderStats computes the average and median individual order size
+// across every resting order in the book.
+func restingOrderStats(bids, asks map[string]*OrderQueue) (avg, median decimal.Decimal) {
+	var sizes []decimal.Decimal
+	for _, queue := range bids {
+		queue.mu.RLock()
+		sizes = append(sizes, queue.orders...)
+		queue.mu.RUnlock()
+	}
+	for _, queue := range asks {
+		queue.mu.RLock()
+		sizes = append(sizes, queue.orders...)
+		queue.mu.RUnlock()
+	}
+
+	if len(sizes) == 0 {
+		return decimal.Zero, decimal.Zero
+	}
+
+	total := decimal.Zero
+	for _, size := range sizes {
+		total = total.Add(size)
+	}
+	avg = total.Div(decimal.NewFromInt(int64(len(sizes))))
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i].LessThan(sizes[j]) })
+	mid := len(sizes) / 2
+	if len(sizes)%2 == 0 {
+		median = sizes[mid-1].Add(sizes[mid]).Div(decimal.NewFromInt(2))
+	} else {
+		median = sizes[mid]
+	}
+	return avg, median
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -50,23 +53,179 @@ func (oq *OrderQueue) largestOrderIndex() int {
 
 // L3 Order Book Engine
 type L3OrderBook struct {
-	bids   map[string]*OrderQueue // price -> order queue
-	asks   map[string]*OrderQueue
-	symbol string
-	lastID int64
-	mu     sync.RWMutex
+	bids        map[string]*OrderQueue // price -> order queue
+	asks        map[string]*OrderQueue
+	symbol      string
+	lastID      int64
+	flow        *OrderFlowAnalyzer
+	resyncCount int64
+	lastGapTime int64 // unix millis of the most recent sequence gap, 0 if none yet
+	persistence Persistence
+	mu          sync.RWMutex
+}
+
+// HealthStatus reports L3 reconstruction quality for the /healthz endpoint.
+type HealthStatus struct {
+	Symbol      string `json:"symbol"`
+	ResyncCount int64  `json:"resync_count"`
+	LastGapTime int64  `json:"last_gap_time_ms,omitempty"`
+}
+
+// recordGap marks that a sequence gap forced a resync.
+func (ob *L3OrderBook) recordGap() {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.resyncCount++
+	ob.lastGapTime = time.Now().UnixMilli()
+}
+
+// Health returns the current reconstruction quality metrics.
+func (ob *L3OrderBook) Health() HealthStatus {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return HealthStatus{
+		Symbol:      ob.symbol,
+		ResyncCount: ob.resyncCount,
+		LastGapTime: ob.lastGapTime,
+	}
+}
+
+// NewL3OrderBook creates a book for symbol and, if persistence is non-nil,
+// attempts to hydrate its queue state from the last persisted snapshot so a
+// restart doesn't collapse back to a single-order-per-level assumption.
+func NewL3OrderBook(symbol string, persistence Persistence) *L3OrderBook {
+	ob := &L3OrderBook{
+		bids:        make(map[string]*OrderQueue),
+		asks:        make(map[string]*OrderQueue),
+		symbol:      symbol,
+		flow:        NewOrderFlowAnalyzer(symbol),
+		persistence: persistence,
+	}
+
+	if persistence != nil {
+		if snap, err := persistence.Load(symbol); err == nil {
+			ob.hydrate(snap)
+		}
+	}
+
+	return ob
+}
+
+// hydrate restores queue state from a previously persisted snapshot.
+func (ob *L3OrderBook) hydrate(snap *PersistedBook) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for price, orders := range snap.Bids {
+		ob.bids[price] = &OrderQueue{orders: append([]decimal.Decimal{}, orders...)}
+	}
+	for price, orders := range snap.Asks {
+		ob.asks[price] = &OrderQueue{orders: append([]decimal.Decimal{}, orders...)}
+	}
+	ob.lastID = snap.LastUpdateID
+
+	log.Printf("L3 Order Book %s hydrated from persisted snapshot: %d bid levels, %d ask levels, lastUpdateId=%d",
+		strings.ToUpper(ob.symbol), len(ob.bids), len(ob.asks), ob.lastID)
+}
+
+// LastUpdateID returns the last applied venue update id, including one
+// restored from a persisted snapshot before any WS connection is made.
+func (ob *L3OrderBook) LastUpdateID() int64 {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.lastID
+}
+
+// snapshotForPersistence captures the full per-price order queues so they
+// can be written out by a Persistence backend.
+func (ob *L3OrderBook) snapshotForPersistence() *PersistedBook {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	snap := &PersistedBook{
+		Symbol:       ob.symbol,
+		LastUpdateID: ob.lastID,
+		Bids:         make(map[string][]decimal.Decimal, len(ob.bids)),
+		Asks:         make(map[string][]decimal.Decimal, len(ob.asks)),
+		SavedAt:      time.Now().UnixMilli(),
+	}
+
+	for price, queue := range ob.bids {
+		queue.mu.RLock()
+		snap.Bids[price] = append([]decimal.Decimal{}, queue.orders...)
+		queue.mu.RUnlock()
+	}
+	for price, queue := range ob.asks {
+		queue.mu.RLock()
+		snap.Asks[price] = append([]decimal.Decimal{}, queue.orders...)
+		queue.mu.RUnlock()
+	}
+
+	return snap
+}
+
+// persist saves the current queue state via the configured backend, if any.
+func (ob *L3OrderBook) persist() {
+	if ob.persistence == nil {
+		return
+	}
+	if err := ob.persistence.Save(ob.snapshotForPersistence()); err != nil {
+		log.Printf("Failed to persist %s snapshot: %v", strings.ToUpper(ob.symbol), err)
+	}
+}
+
+// runPersistence snapshots the book to its persistence backend every
+// interval and once more on graceful shutdown (stop closed).
+func (ob *L3OrderBook) runPersistence(interval time.Duration, stop <-chan struct{}) {
+	if ob.persistence == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ob.persist()
+		case <-stop:
+			ob.persist()
+			return
+		}
+	}
 }
 
-func NewL3OrderBook(symbol string) *L3OrderBook {
-	return &L3OrderBook{
-		bids:   make(map[string]*OrderQueue),
-		asks:   make(map[string]*OrderQueue),
-		symbol: symbol,
+// runFlowAnalysis rolls the book's accumulated order-flow counters into a
+// published FlowMetrics snapshot every flowInterval until stop is closed.
+func (ob *L3OrderBook) runFlowAnalysis(stop <-chan struct{}) {
+	ticker := time.NewTicker(flowInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ob.mu.RLock()
+			ob.flow.snapshot(ob.bids, ob.asks)
+			ob.mu.RUnlock()
+		case <-stop:
+			return
+		}
 	}
 }
 
+// LatestFlowMetrics returns the most recently published order-flow
+// snapshot for this book, if any.
+func (ob *L3OrderBook) LatestFlowMetrics() (FlowMetrics, bool) {
+	return ob.flow.Latest()
+}
+
+// FlowHistory returns the book's full order-flow ring buffer, oldest first.
+func (ob *L3OrderBook) FlowHistory() []FlowMetrics {
+	return ob.flow.History()
+}
+
 // Apply L2 snapshot to initialize L3 queues
-func (ob *L3OrderBook) loadSnapshot(resp *binanceRESTResp) {
+func (ob *L3OrderBook) loadSnapshot(snap *DepthSnapshot) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
 
@@ -75,10 +234,7 @@ func (ob *L3OrderBook) loadSnapshot(resp *binanceRESTResp) {
 	ob.asks = make(map[string]*OrderQueue)
 
 	// Initialize bid queues
-	for _, bid := range resp.Bids {
-		if len(bid) < 2 {
-			continue
-		}
+	for _, bid := range snap.Bids {
 		price := bid[0]
 		qty, err := decimal.NewFromString(bid[1])
 		if err != nil || qty.IsZero() {
@@ -91,10 +247,7 @@ func (ob *L3OrderBook) loadSnapshot(resp *binanceRESTResp) {
 	}
 
 	// Initialize ask queues
-	for _, ask := range resp.Asks {
-		if len(ask) < 2 {
-			continue
-		}
+	for _, ask := range snap.Asks {
 		price := ask[0]
 		qty, err := decimal.NewFromString(ask[1])
 		if err != nil || qty.IsZero() {
@@ -106,21 +259,20 @@ func (ob *L3OrderBook) loadSnapshot(resp *binanceRESTResp) {
 		}
 	}
 
-	ob.lastID = resp.LastUpdateID
+	ob.lastID = snap.LastUpdateID
 	log.Printf("L3 Order Book initialized with %d bid levels, %d ask levels",
 		len(ob.bids), len(ob.asks))
 }
 
 // Apply L2 delta update to reconstruct L3 queues
-func (ob *L3OrderBook) applyDelta(update *binanceWSUpdate) {
+func (ob *L3OrderBook) applyDelta(delta *DepthDelta) {
 	ob.mu.Lock()
 	defer ob.mu.Unlock()
 
+	ob.lastID = delta.FinalUpdateID
+
 	// Process bid updates
-	for _, bid := range update.B {
-		if len(bid) < 2 {
-			continue
-		}
+	for _, bid := range delta.Bids {
 		price := bid[0]
 		newQty, err := decimal.NewFromString(bid[1])
 		if err != nil {
@@ -131,15 +283,12 @@ func (ob *L3OrderBook) applyDelta(update *binanceWSUpdate) {
 			// Remove entire price level
 			delete(ob.bids, price)
 		} else {
-			ob.updateQueue(ob.bids, price, newQty)
+			ob.updateQueue(ob.bids, "bid", price, newQty)
 		}
 	}
 
 	// Process ask updates
-	for _, ask := range update.A {
-		if len(ask) < 2 {
-			continue
-		}
+	for _, ask := range delta.Asks {
 		price := ask[0]
 		newQty, err := decimal.NewFromString(ask[1])
 		if err != nil {
@@ -150,13 +299,13 @@ func (ob *L3OrderBook) applyDelta(update *binanceWSUpdate) {
 			// Remove entire price level
 			delete(ob.asks, price)
 		} else {
-			ob.updateQueue(ob.asks, price, newQty)
+			ob.updateQueue(ob.asks, "ask", price, newQty)
 		}
 	}
 }
 
 // Core L3 Queue Reconstruction Algorithm (based on Rust implementation)
-func (ob *L3OrderBook) updateQueue(side map[string]*OrderQueue, price string, newQty decimal.Decimal) {
+func (ob *L3OrderBook) updateQueue(side map[string]*OrderQueue, sideName, price string, newQty decimal.Decimal) {
 	queue, exists := side[price]
 
 	if !exists {
@@ -164,6 +313,7 @@ func (ob *L3OrderBook) updateQueue(side map[string]*OrderQueue, price string, ne
 		side[price] = &OrderQueue{
 			orders: []decimal.Decimal{newQty},
 		}
+		ob.flow.recordAdd(sideName, price, newQty, decimal.Zero)
 		return
 	}
 
@@ -175,10 +325,21 @@ func (ob *L3OrderBook) updateQueue(side map[string]*OrderQueue, price string, ne
 	if newQty.GreaterThan(oldSum) {
 		// Quantity increased - new order added to back of queue (FIFO)
 		diff := newQty.Sub(oldSum)
+		priorCount := len(queue.orders)
+		var priorAvg decimal.Decimal
+		if priorCount > 0 {
+			priorAvg = oldSum.Div(decimal.NewFromInt(int64(priorCount)))
+		}
 		queue.orders = append(queue.orders, diff)
+		ob.flow.recordAdd(sideName, price, diff, priorAvg)
 
 	} else if newQty.LessThan(oldSum) {
-		// Quantity decreased - remove from largest order first
+		// Quantity decreased. oldSum is queue.sum() taken just above, so it
+		// already reflects any trades applyTrade has depleted from the
+		// front of the queue before this delta arrived; the remaining diff
+		// is treated as a cancellation and applied with the largest-order
+		// heuristic. A trade that is applied after the delta carrying it is
+		// not recognised here, so its share of the drop counts as a cancel.
 		diff := oldSum.Sub(newQty)
 
 		// Find exact match for cancellation (Rust logic)
@@ -188,6 +349,7 @@ func (ob *L3OrderBook) updateQueue(side map[string]*OrderQueue, price string, ne
 				// Remove exact matching order
 				queue.orders = append(queue.orders[:i], queue.orders[i+1:]...)
 				removed = true
+				ob.flow.recordCancel(diff)
 				break
 			}
 		}
@@ -199,9 +361,12 @@ func (ob *L3OrderBook) updateQueue(side map[string]*OrderQueue, price string, ne
 				if queue.orders[largestIdx].GreaterThan(diff) {
 					// Partial reduction of largest order
 					queue.orders[largestIdx] = queue.orders[largestIdx].Sub(diff)
+					ob.flow.recordCancel(diff)
 				} else {
 					// Remove entire largest order
+					removedAmount := queue.orders[largestIdx]
 					queue.orders = append(queue.orders[:largestIdx], queue.orders[largestIdx+1:]...)
+					ob.flow.recordCancel(removedAmount)
 				}
 			}
 		}
@@ -340,20 +505,6 @@ func (ob *L3OrderBook) getL3Snapshot(topLevels int) L3Snapshot {
 	}
 }
 
-// Rest of the implementation (WebSocket, HTTP handlers) remains the same
-type binanceWSUpdate struct {
-	U int64      `json:"u"`
-	u int64      `json:"u"`
-	B [][]string `json:"b"`
-	A [][]string `json:"a"`
-}
-
-type binanceRESTResp struct {
-	LastUpdateID int64      `json:"lastUpdateId"`
-	Bids         [][]string `json:"bids"`
-	Asks         [][]string `json:"asks"`
-}
-
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -361,15 +512,9 @@ func min(a, b int) int {
 	return b
 }
 
-// Global state for symbol switching
-type AppState struct {
-	book         *L3OrderBook
-	currentSymbol string
-	binanceCancel chan bool
-	mu           sync.RWMutex
-}
-
-var appState *AppState
+// bookRegistry tracks one book per subscribed symbol so a single browser
+// session can watch several markets concurrently.
+var bookRegistry *BookRegistry
 
 func main() {
 	symbol := "ethusdt" // Default to ETHUSDT
@@ -377,25 +522,55 @@ func main() {
 		symbol = strings.ToLower(os.Args[1])
 	}
 
-	appState = &AppState{
-		book:          NewL3OrderBook(symbol),
-		currentSymbol: symbol,
-		binanceCancel: make(chan bool, 1),
-	}
+	adapter := newAdapterFromEnv()
+	InitializePrecisionManager(adapter)
+
+	bookRegistry = NewBookRegistry(newPersistenceFromEnv(), adapter)
+	bookRegistry.Subscribe(symbol) // always track the default symbol
 
-	go runBinanceSync(symbol, appState.book, appState.binanceCancel)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		log.Println("Shutting down, persisting final snapshots...")
+		bookRegistry.Shutdown()
+		time.Sleep(200 * time.Millisecond)
+		os.Exit(0)
+	}()
 
 	http.Handle("/", http.FileServer(http.Dir("static")))
 	http.HandleFunc("/ws", wsHandler())
+	http.HandleFunc("/healthz", healthzHandler)
 
 	log.Printf("L3 Order Book Server running on http://localhost:8080")
-	log.Printf("Symbol: %s", strings.ToUpper(symbol))
+	log.Printf("Exchange: %s, default symbol: %s", adapter.Name(), strings.ToUpper(symbol))
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
+// WSMessage is the client->server protocol: subscribe/unsubscribe carry a
+// symbols array so one connection can track several markets at once.
 type WSMessage struct {
-	Type   string `json:"type"`
-	Symbol string `json:"symbol,omitempty"`
+	Type    string   `json:"type"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// wsClient tracks which symbols a single WS connection is subscribed to,
+// and the last order-flow snapshot timestamp sent per symbol so flow_update
+// frames are only pushed once a new interval has actually been published.
+type wsClient struct {
+	symbols    map[string]bool
+	lastFlowTs map[string]int64
+	mu         sync.RWMutex
+}
+
+func (c *wsClient) snapshotSymbols() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	symbols := make([]string, 0, len(c.symbols))
+	for s := range c.symbols {
+		symbols = append(symbols, s)
+	}
+	return symbols
 }
 
 func wsHandler() http.HandlerFunc {
@@ -411,10 +586,24 @@ func wsHandler() http.HandlerFunc {
 		}
 		defer conn.Close()
 
+		if r.URL.Query().Get("mode") == "replay" {
+			serveReplay(conn, r)
+			return
+		}
+
+		client := &wsClient{symbols: make(map[string]bool), lastFlowTs: make(map[string]int64)}
+		var writeMu sync.Mutex
+
+		defer func() {
+			for _, symbol := range client.snapshotSymbols() {
+				bookRegistry.Unsubscribe(symbol)
+			}
+		}()
+
 		ticker := time.NewTicker(50 * time.Millisecond) // 20 FPS for L3 data
 		defer ticker.Stop()
 
-		// Handle incoming messages for symbol switching
+		// Handle incoming subscribe/unsubscribe messages
 		go func() {
 			for {
 				var msg WSMessage
@@ -423,82 +612,120 @@ func wsHandler() http.HandlerFunc {
 					return
 				}
 
-				if msg.Type == "switch_symbol" && msg.Symbol != "" {
-					newSymbol := strings.ToLower(msg.Symbol)
-					log.Printf("Switching to symbol: %s", strings.ToUpper(newSymbol))
-					
-					// Switch symbol
-					if err := switchSymbol(newSymbol); err != nil {
-						errorMsg := map[string]interface{}{
-							"type":    "error",
-							"message": err.Error(),
+				switch msg.Type {
+				case "subscribe":
+					for _, raw := range msg.Symbols {
+						symbol := strings.ToLower(raw)
+						client.mu.Lock()
+						alreadySubscribed := client.symbols[symbol]
+						client.symbols[symbol] = true
+						client.mu.Unlock()
+						if alreadySubscribed {
+							continue
+						}
+						book := bookRegistry.Subscribe(symbol)
+
+						// Backfill the flow chart for a client connecting
+						// mid-session: it has no way to reconstruct history
+						// for a symbol from the per-tick flow_update alone.
+						if history := book.FlowHistory(); len(history) > 0 {
+							writeMu.Lock()
+							conn.WriteJSON(map[string]interface{}{
+								"type":   "flow_history",
+								"symbol": strings.ToUpper(symbol),
+								"data":   history,
+							})
+							writeMu.Unlock()
 						}
-						conn.WriteJSON(errorMsg)
-					} else {
-						// Notify successful switch
-						switchMsg := map[string]interface{}{
-							"type":   "symbol_switched",
-							"symbol": strings.ToUpper(newSymbol),
+					}
+					writeMu.Lock()
+					conn.WriteJSON(map[string]interface{}{"type": "subscribed", "symbols": msg.Symbols})
+					writeMu.Unlock()
+				case "unsubscribe":
+					for _, raw := range msg.Symbols {
+						symbol := strings.ToLower(raw)
+						client.mu.Lock()
+						wasSubscribed := client.symbols[symbol]
+						delete(client.symbols, symbol)
+						client.mu.Unlock()
+						if !wasSubscribed {
+							continue
 						}
-						conn.WriteJSON(switchMsg)
+						bookRegistry.Unsubscribe(symbol)
 					}
+					writeMu.Lock()
+					conn.WriteJSON(map[string]interface{}{"type": "unsubscribed", "symbols": msg.Symbols})
+					writeMu.Unlock()
 				}
 			}
 		}()
 
-		for {
-			select {
-			case <-ticker.C:
-				appState.mu.RLock()
-				snapshot := appState.book.getL3Snapshot(100)
-				appState.mu.RUnlock()
-				
+		for range ticker.C {
+			for _, symbol := range client.snapshotSymbols() {
+				book, ok := bookRegistry.Get(symbol)
+				if !ok {
+					continue
+				}
+
 				message := map[string]interface{}{
-					"type": "l3_update",
-					"data": snapshot,
+					"type":   "l3_update",
+					"symbol": strings.ToUpper(symbol),
+					"data":   book.getL3Snapshot(100),
 				}
 
-				if err := conn.WriteJSON(message); err != nil {
+				writeMu.Lock()
+				err := conn.WriteJSON(message)
+				writeMu.Unlock()
+				if err != nil {
 					return
 				}
+
+				if flowMetrics, ok := book.LatestFlowMetrics(); ok {
+					client.mu.Lock()
+					isNew := flowMetrics.Timestamp > client.lastFlowTs[symbol]
+					if isNew {
+						client.lastFlowTs[symbol] = flowMetrics.Timestamp
+					}
+					client.mu.Unlock()
+
+					if isNew {
+						writeMu.Lock()
+						err := conn.WriteJSON(map[string]interface{}{
+							"type":   "flow_update",
+							"symbol": strings.ToUpper(symbol),
+							"data":   flowMetrics,
+						})
+						writeMu.Unlock()
+						if err != nil {
+							return
+						}
+					}
+				}
 			}
 		}
 	}
 }
 
-func switchSymbol(newSymbol string) error {
-	appState.mu.Lock()
-	defer appState.mu.Unlock()
-
-	if appState.currentSymbol == newSymbol {
-		return nil // Already on this symbol
-	}
-
-	// Cancel current Binance connection
-	select {
-	case appState.binanceCancel <- true:
-	default:
-	}
-
-	// Create new book and start new connection
-	appState.book = NewL3OrderBook(newSymbol)
-	appState.currentSymbol = newSymbol
-	appState.binanceCancel = make(chan bool, 1)
+// healthzHandler reports L3 reconstruction quality for every tracked symbol
+// so operators can see how often each book had to resync.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookRegistry.Health())
+}
 
-	go runBinanceSync(newSymbol, appState.book, appState.binanceCancel)
+func runBinanceSync(symbol string, book *L3OrderBook, cancel chan bool, adapter ExchangeAdapter) {
+	go runAggTradeSync(symbol, book, cancel, adapter)
 
-	return nil
-}
+	recorder := newRecorderFromEnv(symbol)
 
-func runBinanceSync(symbol string, book *L3OrderBook, cancel chan bool) {
 	for {
 		select {
 		case <-cancel:
-			log.Printf("Cancelling Binance sync for %s", strings.ToUpper(symbol))
+			log.Printf("Cancelling %s sync for %s", adapter.Name(), strings.ToUpper(symbol))
 			return
 		default:
-			if err := connectAndSync(symbol, book, cancel); err != nil {
-				log.Printf("Connection failed for %s: %v, retrying in 5s...", strings.ToUpper(symbol), err)
+			if err := connectAndSync(symbol, book, cancel, adapter, recorder); err != nil {
+				log.Printf("Connection failed for %s on %s: %v, retrying in 5s...", strings.ToUpper(symbol), adapter.Name(), err)
 				time.Sleep(5 * time.Second)
 				continue
 			}
@@ -506,53 +733,112 @@ func runBinanceSync(symbol string, book *L3OrderBook, cancel chan bool) {
 	}
 }
 
-func connectAndSync(symbol string, book *L3OrderBook, cancel chan bool) error {
-	wsURL := fmt.Sprintf("wss://fstream.binance.com/ws/%s@depth@100ms", symbol)
+// sequenceTracker carries the running lastApplied/synced state an adapter
+// needs to validate a venue's own sequence-continuity rules across both the
+// buffered-replay and live-streaming phases of a connection.
+type sequenceTracker struct {
+	lastApplied int64
+	synced      bool
+}
 
-	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		return fmt.Errorf("cannot dial Binance WS: %w", err)
+// applyIfValid applies delta if the adapter says it continues the tracked
+// sequence, discards it if it predates the tracked position, or returns an
+// error on a detected gap so the caller can tear down and resync.
+func (st *sequenceTracker) applyIfValid(book *L3OrderBook, adapter ExchangeAdapter, delta *DepthDelta) error {
+	newLastApplied, synced, gap := adapter.ValidateSequence(st.lastApplied, st.synced, delta)
+	if gap != nil {
+		return gap
 	}
-	defer ws.Close()
-
-	log.Println("Connected Binance WS:", wsURL)
+	if synced && newLastApplied != st.lastApplied {
+		book.applyDelta(delta)
+	}
+	st.lastApplied = newLastApplied
+	st.synced = synced
+	return nil
+}
 
-	// Fetch initial snapshot
-	snapURL := fmt.Sprintf("https://fapi.binance.com/fapi/v1/depth?symbol=%s&limit=1000",
-		strings.ToUpper(symbol))
+// resumeFromPersistedState tries to bridge the gap between a hydrated
+// persisted snapshot and the live WS stream by buffering events for a short
+// window. If the earliest buffered event is still within the venue's diff
+// window of the persisted lastUpdateId, the missing deltas are replayed and
+// the caller can skip the REST snapshot entirely. Returns a nil tracker if
+// there is nothing to resume from or the gap is too large to bridge, in
+// which case the caller falls back to a full REST snapshot.
+func resumeFromPersistedState(book *L3OrderBook, ws *websocket.Conn, cancel chan bool, adapter ExchangeAdapter) (*sequenceTracker, error) {
+	persistedID := book.LastUpdateID()
+	if persistedID == 0 {
+		return nil, nil
+	}
 
-	var snapResp binanceRESTResp
-	for {
+	var buffered []*DepthDelta
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
 		select {
 		case <-cancel:
-			return fmt.Errorf("cancelled during snapshot fetch")
+			return nil, fmt.Errorf("cancelled while resuming from persisted state")
 		default:
-			resp, err := http.Get(snapURL)
-			if err == nil && resp.StatusCode == 200 {
-				err2 := json.NewDecoder(resp.Body).Decode(&snapResp)
-				resp.Body.Close()
-				if err2 == nil && snapResp.LastUpdateID != 0 {
-					goto snapshotLoaded
+			ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+					continue
 				}
+				return nil, fmt.Errorf("websocket error while resuming: %w", err)
+			}
+			delta, err := adapter.ParseDelta(msg)
+			if err != nil || delta == nil {
+				continue
+			}
+			if delta.FirstUpdateID == 0 && delta.PrevFinalUpdateID == 0 {
+				// The venue's deltas carry no id to check the gap against.
+				return nil, nil
 			}
-			if resp != nil {
-				resp.Body.Close()
+			buffered = append(buffered, delta)
+			if delta.FirstUpdateID <= persistedID+1 {
+				goto bridged
 			}
-			time.Sleep(200 * time.Millisecond)
 		}
 	}
 
-snapshotLoaded:
-	book.loadSnapshot(&snapResp)
-	log.Printf("L3 Order Book snapshot loaded: %d", snapResp.LastUpdateID)
+bridged:
+	if len(buffered) == 0 || buffered[0].FirstUpdateID > persistedID+1 {
+		// Too far behind to bridge; the caller must refetch a REST snapshot.
+		return nil, nil
+	}
+
+	st := &sequenceTracker{lastApplied: persistedID, synced: true}
+	for _, delta := range buffered {
+		if err := st.applyIfValid(book, adapter, delta); err != nil {
+			// The persisted state can't be bridged either; fall back.
+			return nil, nil
+		}
+	}
+
+	return st, nil
+}
+
+// streamUpdates reads and applies live depth-diff events until cancelled or
+// a sequence gap forces a resync. When recorder is non-nil, every parsed
+// delta (before sequence validation) is also appended to its capture file and the REST snapshot is
+// refetched and recorded every recorderSnapshotInterval, so the session can
+// later be fed back through Replay.
+func streamUpdates(symbol string, book *L3OrderBook, ws *websocket.Conn, cancel chan bool, adapter ExchangeAdapter, st *sequenceTracker, recorder *Recorder) error {
+	var nextSnapshotAt time.Time
+	if recorder != nil {
+		nextSnapshotAt = time.Now().Add(recorderSnapshotInterval)
+	}
 
-	// Process real-time updates
 	for {
 		select {
 		case <-cancel:
-			log.Printf("Cancelling Binance sync for %s", strings.ToUpper(symbol))
+			log.Printf("Cancelling %s sync for %s", adapter.Name(), strings.ToUpper(symbol))
 			return fmt.Errorf("cancelled")
 		default:
+			if recorder != nil && !nextSnapshotAt.IsZero() && time.Now().After(nextSnapshotAt) {
+				recordSnapshotAsync(symbol, adapter, recorder)
+				nextSnapshotAt = time.Now().Add(recorderSnapshotInterval)
+			}
+
 			// Set a reasonable read deadline
 			ws.SetReadDeadline(time.Now().Add(1 * time.Second))
 			_, msg, err := ws.ReadMessage()
@@ -567,13 +853,154 @@ snapshotLoaded:
 				return fmt.Errorf("websocket error: %w", err)
 			}
 
-			var update binanceWSUpdate
-			if err := json.Unmarshal(msg, &update); err != nil {
-				log.Printf("Failed to unmarshal update: %v", err)
+			delta, err := adapter.ParseDelta(msg)
+			if err != nil {
+				log.Printf("Failed to parse update: %v", err)
+				continue
+			}
+			if delta == nil {
+				continue
+			}
+
+			if recorder != nil {
+				recorder.RecordDelta(delta)
+			}
+
+			if err := st.applyIfValid(book, adapter, delta); err != nil {
+				log.Printf("Sequence gap for %s on %s: %v, resyncing...", strings.ToUpper(symbol), adapter.Name(), err)
+				book.recordGap()
+				return err
+			}
+		}
+	}
+}
+
+// recordSnapshotAsync refetches the REST snapshot and hands it to recorder
+// without blocking the streaming loop or touching the live book.
+func recordSnapshotAsync(symbol string, adapter ExchangeAdapter, recorder *Recorder) {
+	go func() {
+		resp, err := http.Get(adapter.SnapshotURL(symbol))
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return
+		}
+		if snap, err := adapter.ParseSnapshot(body); err == nil {
+			recorder.RecordSnapshot(snap)
+		}
+	}()
+}
+
+// connectAndSync implements a managed-book procedure generalized across
+// venues via ExchangeAdapter: buffer WS events while the REST snapshot
+// loads, drop anything stale relative to the snapshot, validate the first
+// applied event straddles the snapshot, and thereafter require unbroken
+// sequence continuity as defined by the adapter. Any violation tears this
+// connection down so the retry in runBinanceSync rebuilds from a fresh
+// snapshot. If the book was hydrated from a recent persisted snapshot, the
+// REST fetch is skipped in favor of replaying just the missing deltas.
+func connectAndSync(symbol string, book *L3OrderBook, cancel chan bool, adapter ExchangeAdapter, recorder *Recorder) error {
+	wsURL := adapter.StreamURL(symbol)
+
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("cannot dial %s WS: %w", adapter.Name(), err)
+	}
+	defer ws.Close()
+
+	log.Printf("Connected %s WS: %s", adapter.Name(), wsURL)
+
+	if sub := adapter.SubscribeMessage(symbol); sub != nil {
+		if err := ws.WriteMessage(websocket.TextMessage, sub); err != nil {
+			return fmt.Errorf("failed to send subscribe message: %w", err)
+		}
+	}
+
+	if st, err := resumeFromPersistedState(book, ws, cancel, adapter); err != nil {
+		return err
+	} else if st != nil {
+		log.Printf("Resumed %s from persisted snapshot at lastUpdateId=%d, skipping REST snapshot",
+			strings.ToUpper(symbol), st.lastApplied)
+		return streamUpdates(symbol, book, ws, cancel, adapter, st, recorder)
+	}
+
+	snapURL := adapter.SnapshotURL(symbol)
+
+	snapCh := make(chan *DepthSnapshot, 1)
+	snapErrCh := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(snapURL)
+		if err != nil {
+			snapErrCh <- err
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != 200 {
+			snapErrCh <- fmt.Errorf("snapshot API returned status %d", resp.StatusCode)
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			snapErrCh <- err
+			return
+		}
+		snap, err := adapter.ParseSnapshot(body)
+		if err != nil {
+			snapErrCh <- err
+			return
+		}
+		snapCh <- snap
+	}()
+
+	// Buffer events while the snapshot is in flight.
+	var buffered []*DepthDelta
+	var snap *DepthSnapshot
+	for snap == nil {
+		select {
+		case <-cancel:
+			return fmt.Errorf("cancelled during snapshot fetch")
+		case err := <-snapErrCh:
+			return fmt.Errorf("snapshot fetch failed: %w", err)
+		case snap = <-snapCh:
+		default:
+			ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+					continue
+				}
+				return fmt.Errorf("websocket error while buffering: %w", err)
+			}
+			delta, err := adapter.ParseDelta(msg)
+			if err != nil || delta == nil {
 				continue
 			}
+			buffered = append(buffered, delta)
+		}
+	}
+
+	book.loadSnapshot(snap)
+	log.Printf("L3 Order Book snapshot loaded: %d", snap.LastUpdateID)
+	if recorder != nil {
+		recorder.RecordSnapshot(snap)
+	}
 
-			book.applyDelta(&update)
+	st := &sequenceTracker{lastApplied: snap.LastUpdateID}
+	for _, delta := range buffered {
+		if recorder != nil {
+			recorder.RecordDelta(delta)
+		}
+		if err := st.applyIfValid(book, adapter, delta); err != nil {
+			book.recordGap()
+			return err
 		}
 	}
+
+	return streamUpdates(symbol, book, ws, cancel, adapter, st, recorder)
 }
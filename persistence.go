@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
+)
+
+// persistenceInterval is how often a book's queue state is snapshotted
+// while running; it is also saved once more on graceful shutdown.
+const persistenceInterval = 30 * time.Second
+
+// PersistedBook is the serialized form of an L3OrderBook's queue state.
+type PersistedBook struct {
+	Symbol       string                       `json:"symbol"`
+	LastUpdateID int64                        `json:"last_update_id"`
+	Bids         map[string][]decimal.Decimal `json:"bids"`
+	Asks         map[string][]decimal.Decimal `json:"asks"`
+	SavedAt      int64                        `json:"saved_at"`
+}
+
+// Persistence is a pluggable backend for warm-restarting L3 queue state,
+// mirroring the pattern bbgo uses for its persistence layer.
+type Persistence interface {
+	Save(snapshot *PersistedBook) error
+	Load(symbol string) (*PersistedBook, error)
+}
+
+// JSONFilePersistence stores one JSON file per symbol on disk.
+type JSONFilePersistence struct {
+	dir string
+}
+
+func NewJSONFilePersistence(dir string) *JSONFilePersistence {
+	return &JSONFilePersistence{dir: dir}
+}
+
+func (p *JSONFilePersistence) path(symbol string) string {
+	return filepath.Join(p.dir, symbol+".json")
+}
+
+func (p *JSONFilePersistence) Save(snapshot *PersistedBook) error {
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return fmt.Errorf("create persistence dir: %w", err)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	// Write to a temp file and rename so a crash mid-write can't corrupt
+	// the last good snapshot.
+	tmp := p.path(snapshot.Symbol) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return os.Rename(tmp, p.path(snapshot.Symbol))
+}
+
+func (p *JSONFilePersistence) Load(symbol string) (*PersistedBook, error) {
+	data, err := os.ReadFile(p.path(symbol))
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot PersistedBook
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// RedisPersistence stores one key per symbol in Redis.
+type RedisPersistence struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+func NewRedisPersistence(addr, keyPrefix string) *RedisPersistence {
+	return &RedisPersistence{
+		client:    redis.NewClient(&redis.Options{Addr: addr}),
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (p *RedisPersistence) key(symbol string) string {
+	return p.keyPrefix + ":" + symbol
+}
+
+func (p *RedisPersistence) Save(snapshot *PersistedBook) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.client.Set(ctx, p.key(snapshot.Symbol), data, 0).Err()
+}
+
+func (p *RedisPersistence) Load(symbol string) (*PersistedBook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := p.client.Get(ctx, p.key(symbol)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot PersistedBook
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// newPersistenceFromEnv picks a persistence backend the same way the rest
+// of the tool reads its connection config: environment variables with a
+// sane local default, no config file.
+func newPersistenceFromEnv() Persistence {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return NewRedisPersistence(addr, "l3book")
+	}
+	return NewJSONFilePersistence("./data")
+}
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/http"
@@ -12,24 +12,6 @@ import (
 	"time"
 )
 
-// ExchangeInfo represents Binance exchange info response
-type ExchangeInfo struct {
-	Symbols []SymbolInfo `json:"symbols"`
-}
-
-// SymbolInfo represents information about a trading symbol
-type SymbolInfo struct {
-	Symbol  string   `json:"symbol"`
-	Filters []Filter `json:"filters"`
-}
-
-// Filter represents a symbol filter (price, lot size, etc.)
-type Filter struct {
-	FilterType string `json:"filterType"`
-	TickSize   string `json:"tickSize,omitempty"`
-	StepSize   string `json:"stepSize,omitempty"`
-}
-
 // PrecisionInfo holds precision data for a symbol
 type PrecisionInfo struct {
 	Symbol        string `json:"symbol"`
@@ -40,16 +22,21 @@ type PrecisionInfo struct {
 	LastUpdated    int64  `json:"last_updated"`
 }
 
-// PrecisionManager manages precision information for symbols
+// PrecisionManager manages precision information for symbols, fetched
+// through an ExchangeAdapter so it stays exchange-agnostic like the rest of
+// the reconstruction engine.
 type PrecisionManager struct {
+	adapter    ExchangeAdapter
 	precisions map[string]*PrecisionInfo
 	mu         sync.RWMutex
 	client     *http.Client
 }
 
-// NewPrecisionManager creates a new precision manager
-func NewPrecisionManager() *PrecisionManager {
+// NewPrecisionManager creates a new precision manager that fetches
+// exchange-info through adapter.
+func NewPrecisionManager(adapter ExchangeAdapter) *PrecisionManager {
 	return &PrecisionManager{
+		adapter:    adapter,
 		precisions: make(map[string]*PrecisionInfo),
 		client: &http.Client{
 			Timeout: 10 * time.Second,
@@ -84,7 +71,8 @@ func calculatePrecision(stepSize string) int {
 	return precision
 }
 
-// FetchPrecisionInfo fetches precision information for a symbol from Binance
+// FetchPrecisionInfo fetches precision information for a symbol through the
+// manager's adapter.
 func (pm *PrecisionManager) FetchPrecisionInfo(symbol string) (*PrecisionInfo, error) {
 	pm.mu.RLock()
 	if info, exists := pm.precisions[symbol]; exists {
@@ -96,9 +84,7 @@ func (pm *PrecisionManager) FetchPrecisionInfo(symbol string) (*PrecisionInfo, e
 	}
 	pm.mu.RUnlock()
 
-	// Fetch from API
-	url := "https://fapi.binance.com/fapi/v1/exchangeInfo"
-	resp, err := pm.client.Get(url)
+	resp, err := pm.client.Get(pm.adapter.ExchangeInfoURL())
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch exchange info: %w", err)
 	}
@@ -108,58 +94,29 @@ func (pm *PrecisionManager) FetchPrecisionInfo(symbol string) (*PrecisionInfo, e
 		return nil, fmt.Errorf("exchange info API returned status %d", resp.StatusCode)
 	}
 
-	var exchangeInfo ExchangeInfo
-	if err := json.NewDecoder(resp.Body).Decode(&exchangeInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode exchange info: %w", err)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange info: %w", err)
 	}
 
-	upperSymbol := strings.ToUpper(symbol)
-	
-	// Find the symbol in the response
-	for _, symbolInfo := range exchangeInfo.Symbols {
-		if symbolInfo.Symbol == upperSymbol {
-			precisionInfo := &PrecisionInfo{
-				Symbol:         symbol,
-				PricePrecision: 2, // Default
-				QtyPrecision:   2, // Default
-				TickSize:       "0.01",
-				StepSize:       "0.01",
-				LastUpdated:    time.Now().Unix(),
-			}
-
-			// Parse filters
-			for _, filter := range symbolInfo.Filters {
-				switch filter.FilterType {
-				case "PRICE_FILTER":
-					if filter.TickSize != "" {
-						precisionInfo.TickSize = filter.TickSize
-						precisionInfo.PricePrecision = calculatePrecision(filter.TickSize)
-					}
-				case "LOT_SIZE":
-					if filter.StepSize != "" {
-						precisionInfo.StepSize = filter.StepSize
-						precisionInfo.QtyPrecision = calculatePrecision(filter.StepSize)
-					}
-				}
-			}
-
-			// Cache the result
-			pm.mu.Lock()
-			pm.precisions[symbol] = precisionInfo
-			pm.mu.Unlock()
-
-			log.Printf("Fetched precision for %s: price=%d, qty=%d, tick=%s, step=%s",
-				strings.ToUpper(symbol), 
-				precisionInfo.PricePrecision, 
-				precisionInfo.QtyPrecision,
-				precisionInfo.TickSize,
-				precisionInfo.StepSize)
-
-			return precisionInfo, nil
-		}
+	precisionInfo, err := pm.adapter.ParsePrecision(body, symbol)
+	if err != nil {
+		return nil, err
 	}
+	precisionInfo.LastUpdated = time.Now().Unix()
+
+	pm.mu.Lock()
+	pm.precisions[symbol] = precisionInfo
+	pm.mu.Unlock()
+
+	log.Printf("Fetched precision for %s: price=%d, qty=%d, tick=%s, step=%s",
+		strings.ToUpper(symbol),
+		precisionInfo.PricePrecision,
+		precisionInfo.QtyPrecision,
+		precisionInfo.TickSize,
+		precisionInfo.StepSize)
 
-	return nil, fmt.Errorf("symbol %s not found in exchange info", upperSymbol)
+	return precisionInfo, nil
 }
 
 // GetPrecisionInfo gets cached precision info or fetches it if not available
@@ -215,7 +172,8 @@ func (pm *PrecisionManager) ClearCache() {
 // Global precision manager instance
 var precisionManager *PrecisionManager
 
-// InitializePrecisionManager initializes the global precision manager
-func InitializePrecisionManager() {
-	precisionManager = NewPrecisionManager()
+// InitializePrecisionManager initializes the global precision manager to
+// fetch exchange-info through adapter.
+func InitializePrecisionManager(adapter ExchangeAdapter) {
+	precisionManager = NewPrecisionManager(adapter)
 }
\ No newline at end of file
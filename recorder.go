@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// recorderRotateInterval bounds how long a single capture file grows before
+// Recorder starts a new one.
+const recorderRotateInterval = 1 * time.Hour
+
+// recorderSnapshotInterval is how often a live sync loop refetches and
+// records a REST snapshot while a Recorder is attached.
+const recorderSnapshotInterval = 5 * time.Minute
+
+// Recorder writes every incoming depth-diff event plus periodic REST
+// snapshots to a rotating capture file, so a live session can later be fed
+// back through Replay for deterministic A/B testing of reconstruction
+// heuristics.
+type Recorder struct {
+	dir         string
+	symbol      string
+	mu          sync.Mutex
+	file        *os.File
+	writer      *bufio.Writer
+	openedAt    time.Time
+	rotateEvery time.Duration
+}
+
+func NewRecorder(dir, symbol string) *Recorder {
+	return &Recorder{dir: dir, symbol: symbol, rotateEvery: recorderRotateInterval}
+}
+
+// RecordSnapshot appends a REST snapshot to the capture file.
+func (rc *Recorder) RecordSnapshot(snap *DepthSnapshot) {
+	rc.write(ReplayEvent{RecvTime: time.Now().UnixMilli(), Kind: "snapshot", Snapshot: snap})
+}
+
+// RecordDelta appends a depth-diff event to the capture file.
+func (rc *Recorder) RecordDelta(delta *DepthDelta) {
+	rc.write(ReplayEvent{RecvTime: time.Now().UnixMilli(), Kind: "delta", Delta: delta})
+}
+
+func (rc *Recorder) write(ev ReplayEvent) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if err := rc.rotateIfNeeded(); err != nil {
+		log.Printf("recorder rotate failed for %s: %v", rc.symbol, err)
+		return
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	rc.writer.Write(data)
+	rc.writer.WriteByte('\n')
+	rc.writer.Flush()
+}
+
+func (rc *Recorder) rotateIfNeeded() error {
+	if rc.file != nil && time.Since(rc.openedAt) < rc.rotateEvery {
+		return nil
+	}
+	if rc.file != nil {
+		rc.writer.Flush()
+		rc.file.Close()
+	}
+
+	if err := os.MkdirAll(rc.dir, 0o755); err != nil {
+		return fmt.Errorf("create recorder dir: %w", err)
+	}
+	name := fmt.Sprintf("%s_%d.jsonl", rc.symbol, time.Now().UnixMilli())
+	f, err := os.Create(filepath.Join(rc.dir, name))
+	if err != nil {
+		return fmt.Errorf("create capture file: %w", err)
+	}
+
+	rc.file = f
+	rc.writer = bufio.NewWriter(f)
+	rc.openedAt = time.Now()
+	return nil
+}
+
+// newRecorderFromEnv builds a Recorder for symbol if RECORD_DIR is set in
+// the environment, the same opt-in-via-env-var pattern used for persistence
+// and the exchange adapter.
+func newRecorderFromEnv(symbol string) *Recorder {
+	dir := os.Getenv("RECORD_DIR")
+	if dir == "" {
+		return nil
+	}
+	return NewRecorder(dir, symbol)
+}
@@ -0,0 +1,112 @@
+package main
+
+import "sync"
+
+// trackedBook bundles a symbol's L3OrderBook with the goroutines keeping it
+// in sync and a reference count of how many WS clients are watching it.
+type trackedBook struct {
+	book *L3OrderBook
+	// cancel is closed (never sent on) to broadcast teardown to both the
+	// depth-stream and aggTrade-stream sync goroutines at once.
+	cancel chan bool
+	stop   chan struct{}
+	refs   int
+}
+
+// BookRegistry runs one depth/aggTrade sync per subscribed symbol so several
+// markets can be watched concurrently instead of tearing down and
+// rebuilding a single book on every symbol switch.
+type BookRegistry struct {
+	persistence Persistence
+	adapter     ExchangeAdapter
+	books       map[string]*trackedBook
+	mu          sync.RWMutex
+}
+
+func NewBookRegistry(persistence Persistence, adapter ExchangeAdapter) *BookRegistry {
+	return &BookRegistry{
+		persistence: persistence,
+		adapter:     adapter,
+		books:       make(map[string]*trackedBook),
+	}
+}
+
+// Subscribe registers interest in symbol, starting its sync goroutines on
+// the first subscriber, and returns its book.
+func (r *BookRegistry) Subscribe(symbol string) *L3OrderBook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tb, exists := r.books[symbol]
+	if !exists {
+		tb = &trackedBook{
+			book:   NewL3OrderBook(symbol, r.persistence),
+			cancel: make(chan bool, 1),
+			stop:   make(chan struct{}),
+		}
+		r.books[symbol] = tb
+		go runBinanceSync(symbol, tb.book, tb.cancel, r.adapter)
+		go tb.book.runPersistence(persistenceInterval, tb.stop)
+		go tb.book.runFlowAnalysis(tb.stop)
+	}
+	tb.refs++
+	return tb.book
+}
+
+// Unsubscribe drops a client's interest in symbol, tearing down its sync
+// goroutines once nobody is watching it anymore.
+func (r *BookRegistry) Unsubscribe(symbol string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tb, exists := r.books[symbol]
+	if !exists {
+		return
+	}
+
+	tb.refs--
+	if tb.refs > 0 {
+		return
+	}
+
+	close(tb.cancel)
+	close(tb.stop)
+	delete(r.books, symbol)
+}
+
+// Get returns the book currently tracked for symbol, if any.
+func (r *BookRegistry) Get(symbol string) (*L3OrderBook, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tb, exists := r.books[symbol]
+	if !exists {
+		return nil, false
+	}
+	return tb.book, true
+}
+
+// Health reports reconstruction quality for every currently tracked symbol.
+func (r *BookRegistry) Health() []HealthStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]HealthStatus, 0, len(r.books))
+	for _, tb := range r.books {
+		statuses = append(statuses, tb.book.Health())
+	}
+	return statuses
+}
+
+// Shutdown cancels every tracked sync goroutine and signals its persistence
+// loop to take a final snapshot. It returns without waiting for those
+// snapshots to be written.
+func (r *BookRegistry) Shutdown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, tb := range r.books {
+		close(tb.cancel)
+		close(tb.stop)
+	}
+}
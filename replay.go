@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serveReplay drives a WS connection in replay mode: it loads a capture
+// from the ?file= directory, feeds it into a fresh in-memory book at the
+// requested ?pace=, and streams the same l3_update frames the live path
+// does under ?mode=replay. A client can send {"type":"step"} to advance a
+// step-paced replay one event at a time.
+func serveReplay(conn *websocket.Conn, r *http.Request) {
+	query := r.URL.Query()
+	dir := query.Get("file")
+	if dir == "" {
+		conn.WriteJSON(map[string]interface{}{"type": "error", "message": "missing file parameter"})
+		return
+	}
+	symbol := strings.ToUpper(query.Get("symbol"))
+	if symbol == "" {
+		symbol = "REPLAY"
+	}
+	pace, factor := parseReplayPace(query.Get("pace"))
+
+	book := NewL3OrderBook(strings.ToLower(symbol), nil)
+	replay := NewReplay(book, pace, factor)
+
+	cancel := make(chan bool, 1)
+	done := make(chan error, 1)
+	go func() { done <- replay.Run(dir, cancel) }()
+
+	var writeMu sync.Mutex
+
+	go func() {
+		for {
+			var msg WSMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				select {
+				case cancel <- true:
+				default:
+				}
+				return
+			}
+			if msg.Type == "step" {
+				replay.Step()
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			message := map[string]interface{}{"type": "replay_done"}
+			if err != nil {
+				message["error"] = err.Error()
+			}
+			writeMu.Lock()
+			conn.WriteJSON(message)
+			writeMu.Unlock()
+			return
+		case <-ticker.C:
+			message := map[string]interface{}{
+				"type":   "l3_update",
+				"symbol": symbol,
+				"data":   book.getL3Snapshot(100),
+			}
+			writeMu.Lock()
+			err := conn.WriteJSON(message)
+			writeMu.Unlock()
+			if err != nil {
+				select {
+				case cancel <- true:
+				default:
+				}
+				return
+			}
+		}
+	}
+}
+
+// ReplayEvent is one recorded snapshot or delta, tagged with the wall-clock
+// time it was captured so Replay can reproduce the original pacing.
+type ReplayEvent struct {
+	RecvTime int64          `json:"recv_time"` // unix millis
+	Kind     string         `json:"kind"`      // "snapshot" or "delta"
+	Snapshot *DepthSnapshot `json:"snapshot,omitempty"`
+	Delta    *DepthDelta    `json:"delta,omitempty"`
+}
+
+// ReplayPace selects how quickly Replay.Run feeds events into the book.
+type ReplayPace int
+
+const (
+	PaceWallClock   ReplayPace = iota // reproduce the original inter-event gaps
+	PaceAccelerated                   // reproduce gaps divided by a speed factor
+	PaceStep                          // advance one event per call to Step
+)
+
+// parseReplayPace parses the ?pace= query value, e.g. "wallclock",
+// "accelerated:10", or "step". Defaults to wall-clock pace.
+func parseReplayPace(raw string) (ReplayPace, float64) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	switch {
+	case raw == "step":
+		return PaceStep, 0
+	case strings.HasPrefix(raw, "accelerated"):
+		factor := 10.0
+		if parts := strings.SplitN(raw, ":", 2); len(parts) == 2 {
+			if f, err := strconv.ParseFloat(parts[1], 64); err == nil && f > 0 {
+				factor = f
+			}
+		}
+		return PaceAccelerated, factor
+	default:
+		return PaceWallClock, 1
+	}
+}
+
+// Replay feeds a recorded capture into an L3OrderBook so reconstruction
+// heuristics (like updateQueue's largest-order-first cancellation) can be
+// A/B tested deterministically against the same tape instead of a live
+// stream.
+type Replay struct {
+	book   *L3OrderBook
+	pace   ReplayPace
+	factor float64
+	step   chan struct{}
+}
+
+func NewReplay(book *L3OrderBook, pace ReplayPace, factor float64) *Replay {
+	return &Replay{book: book, pace: pace, factor: factor, step: make(chan struct{})}
+}
+
+// Step advances a step-paced replay by one event; harmless to call for
+// other paces.
+func (rp *Replay) Step() {
+	select {
+	case rp.step <- struct{}{}:
+	default:
+	}
+}
+
+// Run streams every event found under dir into the book in recv-time order,
+// honoring the configured pace, until cancel fires or the tape runs out.
+func (rp *Replay) Run(dir string, cancel chan bool) error {
+	events, err := loadReplayEvents(dir)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no replay events found in %s", dir)
+	}
+
+	for i, ev := range events {
+		select {
+		case <-cancel:
+			return fmt.Errorf("cancelled")
+		default:
+		}
+
+		if i > 0 {
+			if err := rp.wait(events[i-1].RecvTime, ev.RecvTime, cancel); err != nil {
+				return err
+			}
+		}
+
+		switch ev.Kind {
+		case "snapshot":
+			if ev.Snapshot != nil {
+				rp.book.loadSnapshot(ev.Snapshot)
+			}
+		case "delta":
+			if ev.Delta != nil {
+				rp.book.applyDelta(ev.Delta)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rp *Replay) wait(prevRecvTime, recvTime int64, cancel chan bool) error {
+	switch rp.pace {
+	case PaceWallClock, PaceAccelerated:
+		gap := time.Duration(recvTime-prevRecvTime) * time.Millisecond
+		if rp.pace == PaceAccelerated {
+			gap = time.Duration(float64(gap) / rp.factor)
+		}
+		if gap > 0 {
+			time.Sleep(gap)
+		}
+	case PaceStep:
+		select {
+		case <-rp.step:
+		case <-cancel:
+			return fmt.Errorf("cancelled")
+		}
+	}
+	return nil
+}
+
+// loadReplayEvents reads every capture file in dir (raw .jsonl recordings
+// or Tardis-style .csv.gz exports) and returns their events sorted by
+// capture time.
+func loadReplayEvents(dir string) ([]ReplayEvent, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read replay dir: %w", err)
+	}
+
+	var events []ReplayEvent
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case strings.HasSuffix(entry.Name(), ".jsonl"):
+			evs, err := loadJSONLEvents(path)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, evs...)
+		case strings.HasSuffix(entry.Name(), ".csv.gz"):
+			evs, err := loadTardisEvents(path)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, evs...)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].RecvTime < events[j].RecvTime })
+	return events, nil
+}
+
+func loadJSONLEvents(path string) ([]ReplayEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var events []ReplayEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var ev ReplayEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		events = append(events, ev)
+	}
+	return events, scanner.Err()
+}
+
+// loadTardisEvents reads a Tardis-style incremental_book_L2 export: gzip'd
+// CSV with columns including local_timestamp, is_snapshot, side, price and
+// amount. Each run of consecutive is_snapshot=true rows is folded into one
+// DepthSnapshot stamped with the first row's local_timestamp; everything
+// else becomes a one-level DepthDelta.
+func loadTardisEvents(path string) ([]ReplayEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("gunzip %s: %w", path, err)
+	}
+	defer gz.Close()
+
+	reader := csv.NewReader(gz)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header %s: %w", path, err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[name] = i
+	}
+
+	var events []ReplayEvent
+	var snapBids, snapAsks [][2]string
+	var snapTS int64
+	inSnapshot := false
+
+	flushSnapshot := func() {
+		if len(snapBids) == 0 && len(snapAsks) == 0 {
+			return
+		}
+		events = append(events, ReplayEvent{
+			RecvTime: snapTS,
+			Kind:     "snapshot",
+			Snapshot: &DepthSnapshot{Bids: snapBids, Asks: snapAsks},
+		})
+		snapBids, snapAsks = nil, nil
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read row %s: %w", path, err)
+		}
+
+		localTS, _ := strconv.ParseInt(row[col["local_timestamp"]], 10, 64)
+		localTS /= 1000 // micros -> millis
+		isSnapshot := row[col["is_snapshot"]] == "true"
+		side := row[col["side"]]
+		price := row[col["price"]]
+		amount := row[col["amount"]]
+
+		if isSnapshot {
+			if !inSnapshot {
+				flushSnapshot()
+				inSnapshot = true
+				snapTS = localTS
+			}
+			if side == "bid" {
+				snapBids = append(snapBids, [2]string{price, amount})
+			} else {
+				snapAsks = append(snapAsks, [2]string{price, amount})
+			}
+			continue
+		}
+
+		if inSnapshot {
+			flushSnapshot()
+			inSnapshot = false
+		}
+
+		delta := &DepthDelta{}
+		if side == "bid" {
+			delta.Bids = [][2]string{{price, amount}}
+		} else {
+			delta.Asks = [][2]string{{price, amount}}
+		}
+		events = append(events, ReplayEvent{RecvTime: localTS, Kind: "delta", Delta: delta})
+	}
+	flushSnapshot()
+
+	return events, nil
+}
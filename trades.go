@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+// binanceAggTrade is a single event from the @aggTrade stream.
+type binanceAggTrade struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	TradeTime    int64  `json:"T"`
+	IsBuyerMaker bool   `json:"m"`
+}
+
+// applyTrade replays a real fill against the resting queue so that trades
+// deplete the front of the queue (the oldest orders) instead of the
+// largest-order heuristic used for plain cancellations. A buyer-maker trade
+// fills a resting bid; a seller-maker trade fills a resting ask.
+func (ob *L3OrderBook) applyTrade(price string, qty decimal.Decimal, isBuyerMaker bool) {
+	ob.mu.RLock()
+	side := ob.asks
+	if isBuyerMaker {
+		side = ob.bids
+	}
+	queue, exists := side[price]
+	ob.mu.RUnlock()
+
+	if exists {
+		queue.mu.Lock()
+		remaining := qty
+		for len(queue.orders) > 0 && remaining.GreaterThan(decimal.Zero) {
+			head := queue.orders[0]
+			if head.GreaterThan(remaining) {
+				queue.orders[0] = head.Sub(remaining)
+				remaining = decimal.Zero
+			} else {
+				remaining = remaining.Sub(head)
+				queue.orders = queue.orders[1:]
+			}
+		}
+		queue.mu.Unlock()
+	}
+
+	ob.flow.recordMarketVolume(isBuyerMaker, qty)
+}
+
+// aggTradeHost returns the combined-stream host to use for a Binance
+// adapter's aggTrade stream, or "" if the adapter has no aggTrade
+// integration (the trade-aware depletion path is Binance-only for now).
+func aggTradeHost(adapter ExchangeAdapter) string {
+	switch adapter.Name() {
+	case "binance-futures":
+		return "fstream.binance.com"
+	case "binance-spot":
+		return "stream.binance.com:9443"
+	default:
+		return ""
+	}
+}
+
+// runAggTradeSync keeps the aggTrade stream connected for symbol, retrying
+// on failure, mirroring runBinanceSync's behavior for the depth stream. It
+// is a no-op for venues without an aggTrade-equivalent integration.
+func runAggTradeSync(symbol string, book *L3OrderBook, cancel chan bool, adapter ExchangeAdapter) {
+	host := aggTradeHost(adapter)
+	if host == "" {
+		return
+	}
+
+	for {
+		select {
+		case <-cancel:
+			return
+		default:
+			if err := connectAggTrade(symbol, book, cancel, host); err != nil {
+				log.Printf("aggTrade connection failed for %s: %v, retrying in 5s...", strings.ToUpper(symbol), err)
+				time.Sleep(5 * time.Second)
+				continue
+			}
+		}
+	}
+}
+
+func connectAggTrade(symbol string, book *L3OrderBook, cancel chan bool, host string) error {
+	wsURL := combinedStreamURL(host, fmt.Sprintf("%s@aggTrade", symbol))
+
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return fmt.Errorf("cannot dial Binance aggTrade WS: %w", err)
+	}
+	defer ws.Close()
+
+	log.Println("Connected Binance aggTrade WS:", wsURL)
+
+	for {
+		select {
+		case <-cancel:
+			return fmt.Errorf("cancelled")
+		default:
+			ws.SetReadDeadline(time.Now().Add(1 * time.Second))
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					return fmt.Errorf("aggTrade websocket read error: %w", err)
+				}
+				if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+					continue
+				}
+				return fmt.Errorf("aggTrade websocket error: %w", err)
+			}
+
+			data, err := unwrapCombinedMessage(msg)
+			if err != nil {
+				log.Printf("Failed to unwrap combined stream message: %v", err)
+				continue
+			}
+
+			var trade binanceAggTrade
+			if err := json.Unmarshal(data, &trade); err != nil {
+				log.Printf("Failed to unmarshal aggTrade: %v", err)
+				continue
+			}
+
+			qty, err := decimal.NewFromString(trade.Quantity)
+			if err != nil {
+				continue
+			}
+
+			book.applyTrade(trade.Price, qty, trade.IsBuyerMaker)
+		}
+	}
+}